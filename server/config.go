@@ -0,0 +1,91 @@
+package server
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ServerConfig holds the [server] section of config.toml.
+type ServerConfig struct {
+	ListenAddress string `toml:"listen_address"`
+	BasePath      string `toml:"base_path"`
+
+	// ControlAddress, when set, binds a separate HTTP control server
+	// exposing /-/reload, /-/ready and /-/healthy.
+	ControlAddress string `toml:"control_address"`
+
+	// AutoReloadConfig opts into watching configPath (and any files it
+	// includes) for changes and reloading automatically, instead of
+	// requiring SIGHUP.
+	AutoReloadConfig bool `toml:"auto_reload_config"`
+
+	// PreinitGracePeriod bounds how long a SIGHUP reload may take before the
+	// pre-init 503 handler is reinstalled in place of the previous backend.
+	PreinitGracePeriod time.Duration `toml:"preinit_grace_period"`
+
+	// UpgradeHammerTimeout bounds how long a SIGUSR2 upgrade waits for
+	// in-flight tus PATCH requests to finish draining; the old process then
+	// shuts down as on SIGTERM, which waits up to a further 30 seconds for
+	// requests still being served.
+	UpgradeHammerTimeout time.Duration `toml:"upgrade_hammer_timeout"`
+}
+
+// Config is the root of config.toml.
+type Config struct {
+	Server ServerConfig `toml:"server"`
+
+	// Include lists additional config files merged into this one, e.g.
+	// `include = ["conf.d/storage.toml"]`. Paths are relative to the
+	// directory containing the file that references them.
+	Include []string `toml:"include"`
+}
+
+// NewConfig returns a Config populated with defaults.
+func NewConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress: "127.0.0.1:1080",
+			BasePath:      "/files/",
+		},
+	}
+}
+
+// Load reads and parses configPath, overwriting fields present in the file,
+// then merges in any files it includes. Include paths are resolved relative
+// to the directory containing configPath, not the process's working
+// directory.
+func (c *Config) Load(configPath string) error {
+	if _, err := toml.DecodeFile(configPath, c); err != nil {
+		return err
+	}
+
+	for _, include := range c.Include {
+		if _, err := toml.DecodeFile(c.resolveInclude(configPath, include), c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IncludedPaths returns the config files this config was loaded from,
+// including configPath itself, so callers can watch all of them for
+// changes.
+func (c *Config) IncludedPaths(configPath string) []string {
+	paths := []string{configPath}
+	for _, include := range c.Include {
+		paths = append(paths, c.resolveInclude(configPath, include))
+	}
+	return paths
+}
+
+// resolveInclude joins a relative include path against the directory
+// containing configPath. Absolute include paths are returned unchanged.
+func (c *Config) resolveInclude(configPath, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(configPath), include)
+}
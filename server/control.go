@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runControlServer starts a small control-plane HTTP server exposing
+// POST /-/reload, GET /-/ready and GET /-/healthy, matching the pattern many
+// Prometheus-ecosystem services use. It gives operators (Kubernetes probes,
+// CI, config-management tools) a way to reload config without shell access
+// to send signals. It blocks until the listener fails, so callers should run
+// it in its own goroutine.
+func runControlServer(addr string, reloadRequested chan<- struct{}, ready *int32) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/reload", handleReload(reloadRequested))
+	mux.HandleFunc("/-/ready", handleReady(ready))
+	mux.HandleFunc("/-/healthy", handleHealthy)
+
+	log.Info().
+		Str("event", "startup").
+		Str("address", addr).
+		Msg("Control server listening")
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error().Err(err).Msg("Control server stopped")
+	}
+}
+
+// handleReload pushes to the same reloadRequested channel that a SIGHUP
+// drives, so a reload triggered over HTTP goes through the exact config
+// reload path as one triggered by signal.
+func handleReload(reloadRequested chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		select {
+		case reloadRequested <- struct{}{}:
+		default:
+			// a reload is already pending, nothing more to do
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleReady reports 503 while the current upload server instance is still
+// initializing, including again during each config reload, and 200 once it
+// is listening.
+func handleReady(ready *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleHealthy always reports 200 once the control server itself is
+// serving requests; it does not depend on upload server readiness.
+func handleHealthy(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inFlightTracker counts requests currently being served so a graceful
+// upgrade can wait for tus uploads to finish rather than cutting
+// them off mid-PATCH. UploadServer wraps its handler chain with Wrap and
+// calls Drain from ShutdownAfterDrain once a replacement process has taken
+// over accepting new connections.
+type inFlightTracker struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{idle: make(chan struct{})}
+}
+
+// Wrap increments the in-flight count for the duration of each request. Only
+// PATCH requests (tus upload chunks) are tracked, since those are the only
+// ones whose resumability would be broken by an abrupt restart.
+func (t *inFlightTracker) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t.enter()
+		defer t.leave()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *inFlightTracker) enter() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count++
+}
+
+func (t *inFlightTracker) leave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count--
+	if t.count == 0 {
+		close(t.idle)
+		t.idle = make(chan struct{})
+	}
+}
+
+// Drain blocks until no PATCH requests are in flight or the given timeout
+// elapses, whichever comes first. A timeout of zero waits indefinitely.
+func (t *inFlightTracker) Drain(timeout time.Duration) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		t.mu.Lock()
+		count := t.count
+		idle := t.idle
+		t.mu.Unlock()
+
+		if count == 0 {
+			return
+		}
+
+		select {
+		case <-idle:
+		case <-deadline:
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInFlightTrackerDrainReturnsImmediatelyWhenIdle(t *testing.T) {
+	tracker := newInFlightTracker()
+
+	done := make(chan struct{})
+	go func() {
+		tracker.Drain(time.Second)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Drain did not return immediately with nothing in flight")
+	}
+}
+
+func TestInFlightTrackerDrainWaitsForInFlightPatch(t *testing.T) {
+	tracker := newInFlightTracker()
+	release := make(chan struct{})
+
+	handler := tracker.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	requestDone := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/files/abc", nil))
+		close(requestDone)
+	}()
+
+	// Give the PATCH time to enter before draining, so Drain actually has
+	// to wait rather than racing it to the count check.
+	time.Sleep(20 * time.Millisecond)
+
+	drainDone := make(chan struct{})
+	go func() {
+		tracker.Drain(time.Second)
+		close(drainDone)
+	}()
+
+	select {
+	case <-drainDone:
+		t.Fatal("Drain returned while a PATCH was still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-requestDone
+
+	select {
+	case <-drainDone:
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return after the in-flight PATCH completed")
+	}
+}
+
+func TestInFlightTrackerDrainTimesOut(t *testing.T) {
+	tracker := newInFlightTracker()
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := tracker.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/files/abc", nil))
+
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	tracker.Drain(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Drain took %s, expected to return shortly after its timeout", elapsed)
+	}
+}
+
+func TestInFlightTrackerOnlyTracksPatchRequests(t *testing.T) {
+	tracker := newInFlightTracker()
+
+	handler := tracker.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodHead} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/files/abc", nil))
+	}
+
+	// None of the above should have registered as in flight, so Drain must
+	// return immediately regardless of ordering.
+	done := make(chan struct{})
+	go func() {
+		tracker.Drain(time.Second)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Drain blocked even though only non-PATCH requests were served")
+	}
+}
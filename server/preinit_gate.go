@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+)
+
+// preinitGate arbitrates between UploadServer.Run installing the real tus
+// handler and runLoop's pre-init grace timer giving up and reinstalling the
+// 503 fallback, so the two can't interleave. Both actions go through a
+// single mutex-guarded critical section rather than a flag checked
+// separately from the SetHandler call it guards, closing the window where
+// the timer could land between "handler installed" and "that fact
+// recorded" and clobber the real handler with a stale 503 afterward. Once
+// installReal has run, giveUp is permanently a no-op -- but installReal
+// itself is unconditional, so a backend that finishes starting after the
+// grace timer already fired still gets its handler installed, just late.
+type preinitGate struct {
+	mu        sync.Mutex
+	installed bool
+}
+
+// installReal installs real as handler's delegate and marks the gate so any
+// giveUp call from here on is a no-op.
+func (g *preinitGate) installReal(handler *ReplaceableHandler, real http.Handler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	handler.SetHandler(real)
+	g.installed = true
+}
+
+// giveUp installs fallback as handler's delegate, unless installReal has
+// already run, in which case it does nothing and reports false. Used by the
+// pre-init grace timer to avoid clobbering a real handler that beat it to
+// the install.
+func (g *preinitGate) giveUp(handler *ReplaceableHandler, fallback http.Handler) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.installed {
+		return false
+	}
+	handler.SetHandler(fallback)
+	return true
+}
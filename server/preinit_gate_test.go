@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func handlerTag(tag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Tag", tag)
+	})
+}
+
+func installedTag(t *testing.T, h *ReplaceableHandler) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/abc", nil))
+	return w.Header().Get("X-Tag")
+}
+
+func TestPreinitGateInstallRealWinsOverLateGiveUp(t *testing.T) {
+	h := &ReplaceableHandler{}
+	var gate preinitGate
+
+	gate.installReal(h, handlerTag("real"))
+
+	if ok := gate.giveUp(h, handlerTag("fallback")); ok {
+		t.Fatal("giveUp reported acting after installReal had already run")
+	}
+	if got := installedTag(t, h); got != "real" {
+		t.Fatalf("installed handler = %q, want %q", got, "real")
+	}
+}
+
+func TestPreinitGateInstallRealReplacesEarlierGiveUp(t *testing.T) {
+	h := &ReplaceableHandler{}
+	var gate preinitGate
+
+	if ok := gate.giveUp(h, handlerTag("fallback")); !ok {
+		t.Fatal("giveUp reported not acting on an unclaimed gate")
+	}
+
+	gate.installReal(h, handlerTag("real"))
+
+	if got := installedTag(t, h); got != "real" {
+		t.Fatalf("installed handler = %q, want %q; installReal must still win even after giveUp fired first", got, "real")
+	}
+}
+
+// TestPreinitGateConcurrentInstallAndGiveUp exercises the exact race the
+// grace timer and UploadServer.Run can hit: both sides racing to install
+// their handler at roughly the same time. Whichever call preinitGate serializes
+// first, installReal must be the one the handler ends up with once both
+// have returned -- giveUp may only act if it strictly precedes installReal,
+// and its fallback is then replaced by installReal.
+func TestPreinitGateConcurrentInstallAndGiveUp(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		h := &ReplaceableHandler{}
+		var gate preinitGate
+		var wg sync.WaitGroup
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			gate.giveUp(h, handlerTag("fallback"))
+		}()
+		go func() {
+			defer wg.Done()
+			gate.installReal(h, handlerTag("real"))
+		}()
+		wg.Wait()
+
+		if got := installedTag(t, h); got != "real" {
+			t.Fatalf("iteration %d: installed handler = %q, want %q (giveUp clobbered installReal)", i, got, "real")
+		}
+	}
+}
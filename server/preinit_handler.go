@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PreinitHandler serves 503 Service Unavailable for every path, with a
+// Retry-After header only when it was built with a positive retryAfter;
+// the instance runLoop installs at startup is built with zero and sends no
+// Retry-After header. It's installed as ReplaceableHandler's delegate before the
+// real tus handler is ready, so requests that arrive while the upload
+// backend is still initializing -- or while a SIGHUP reload is taking
+// longer than its grace period -- get an explicit "not ready" response
+// instead of being routed to a handler backed by a server that isn't
+// actually listening.
+type PreinitHandler struct {
+	retryAfter time.Duration
+}
+
+// newPreinitHandler returns a PreinitHandler advertising retryAfter via the
+// Retry-After header, truncated to whole seconds as the header requires. A
+// non-positive retryAfter omits the header.
+func newPreinitHandler(retryAfter time.Duration) *PreinitHandler {
+	return &PreinitHandler{retryAfter: retryAfter}
+}
+
+func (h *PreinitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.retryAfter.Seconds())))
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
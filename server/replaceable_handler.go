@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ReplaceableHandler delegates to an inner http.Handler that can be swapped
+// out at runtime via SetHandler. It's mounted on the parent router exactly
+// once per route prefix; config reloads, upgrades and the pre-init 503
+// handler all work by replacing what it delegates to rather than by
+// re-registering a new handler with the router.
+type ReplaceableHandler struct {
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+// SetHandler atomically swaps the handler ReplaceableHandler delegates to.
+func (h *ReplaceableHandler) SetHandler(handler http.Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler = handler
+}
+
+func (h *ReplaceableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	handler := h.handler
+	h.mu.RUnlock()
+
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
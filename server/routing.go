@@ -0,0 +1,18 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// routePrefixFromBasePath derives the pattern to register on the parent
+// router from the configured base path, e.g. "/files/" -> "/files/".
+func routePrefixFromBasePath(basePath string) (string, error) {
+	if basePath == "" {
+		return "", fmt.Errorf("base path must not be empty")
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		return "", fmt.Errorf("base path %q must start with /", basePath)
+	}
+	return basePath, nil
+}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -19,14 +22,15 @@ func RunServer(router *http.ServeMux, configPath string) {
 	var wg sync.WaitGroup
 
 	reloadRequested := make(chan struct{}, 1)
+	upgradeRequested := make(chan struct{}, 1)
 	done := make(chan struct{}, 1)
 
 	// signal handler
-	go signalHandler(reloadRequested, done)
+	go signalHandler(reloadRequested, upgradeRequested, done)
 
 	// server run loop
 	wg.Add(1)
-	go runLoop(reloadRequested, done, &wg, router, configPath)
+	go runLoop(reloadRequested, upgradeRequested, done, &wg, router, configPath)
 
 	wg.Wait()
 	log.Info().
@@ -34,10 +38,10 @@ func RunServer(router *http.ServeMux, configPath string) {
 		Msg("Shutdown complete")
 }
 
-func signalHandler(reloadRequested, done chan struct{}) {
+func signalHandler(reloadRequested, upgradeRequested, done chan struct{}) {
 	signals := make(chan os.Signal, 1)
 
-	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR2, syscall.SIGINT, syscall.SIGTERM)
 
 	for {
 		switch sig := <-signals; sig {
@@ -45,6 +49,9 @@ func signalHandler(reloadRequested, done chan struct{}) {
 		case syscall.SIGHUP:
 			reloadRequested <- struct{}{}
 
+		case syscall.SIGUSR2:
+			upgradeRequested <- struct{}{}
+
 		case syscall.SIGINT:
 			fallthrough
 		case syscall.SIGTERM:
@@ -54,14 +61,58 @@ func signalHandler(reloadRequested, done chan struct{}) {
 	}
 }
 
-func runLoop(reloadRequested, done chan struct{}, wg *sync.WaitGroup, parentRouter *http.ServeMux, configPath string) {
+func runLoop(reloadRequested, upgradeRequested, done chan struct{}, wg *sync.WaitGroup, parentRouter *http.ServeMux, configPath string) {
 	var replaceableHandler *ReplaceableHandler
 	if parentRouter != nil {
 		replaceableHandler = &ReplaceableHandler{}
+		// Served until the first UploadServer swaps in the real tus handler,
+		// so requests that race startup get an explicit "not ready" response
+		// instead of hitting nothing.
+		replaceableHandler.SetHandler(newPreinitHandler(0))
 	}
 	registeredPrefixes := make(map[string]struct{}, 0)
 
+	// ready reports whether the upload server has finished initialization
+	// and is currently listening. The control server's /-/ready endpoint
+	// reads it on every request, so it's updated via atomic rather than
+	// guarded by a mutex.
+	var ready int32
+	controlServerStarted := false
+	configWatcherStarted := false
+
+	// Either adopt the listener handed down by a parent process during a
+	// SIGUSR2 upgrade (or by systemd-style socket activation on startup), or
+	// bind a fresh one ourselves. UploadServer.Run accepts a listener
+	// instead of always calling net.Listen, which is what makes handing one
+	// off across a re-exec possible. canonicalListener itself is never
+	// Served directly, though -- each pass through the loop below hands Run
+	// a dup of it instead, so one instance's Shutdown closing whatever
+	// listener it was Served with can't take the socket down for the next
+	// one.
+	canonicalListener, inherited, err := listenerFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to adopt inherited listening socket")
+	}
+	if inherited {
+		log.Info().
+			Str("event", "startup").
+			Msg("Adopted listening socket from parent process")
+	}
+	if parentRouter != nil && canonicalListener != nil {
+		// Embedded mode serves through replaceableHandler, not a bound
+		// listener of its own, so there's nothing to hand an inherited
+		// socket to -- socket activation can't be honored when mounted on a
+		// parent router. Close it rather than leaking the fd.
+		log.Warn().
+			Str("event", "startup").
+			Msg("Ignoring inherited listening socket: socket activation is not supported when mounted on a parent router")
+		_ = canonicalListener.Close()
+		canonicalListener = nil
+	}
+
 	for {
+		atomic.StoreInt32(&ready, 0)
+
 		// new server instance
 		serv := UploadServer{}
 		serv.cfg = *NewConfig()
@@ -72,6 +123,20 @@ func runLoop(reloadRequested, done chan struct{}, wg *sync.WaitGroup, parentRout
 			log.Error().Err(err).Msg("Failed to load config")
 		}
 
+		// start the control server once, the first time we have a config to
+		// read its address from; it outlives individual server instances
+		if !controlServerStarted && serv.cfg.Server.ControlAddress != "" {
+			controlServerStarted = true
+			go runControlServer(serv.cfg.Server.ControlAddress, reloadRequested, &ready)
+		}
+
+		// likewise, start watching configPath (and anything it includes) for
+		// changes once, opt-in only
+		if !configWatcherStarted && serv.cfg.Server.AutoReloadConfig {
+			configWatcherStarted = true
+			go watchConfigForChanges(serv.cfg.IncludedPaths(configPath), reloadRequested)
+		}
+
 		// register handler on parentRouter if any, when prefix has not been previously registered
 		if parentRouter != nil {
 			routePrefix, err := routePrefixFromBasePath(serv.cfg.Server.BasePath)
@@ -93,16 +158,66 @@ func runLoop(reloadRequested, done chan struct{}, wg *sync.WaitGroup, parentRout
 
 		errChan := make(chan error)
 
+		// Each instance gets its own dup of canonicalListener to own and
+		// (eventually) close, rather than the literal canonical object --
+		// see the comment above canonicalListener's declaration.
+		var runListener net.Listener
+		if canonicalListener != nil {
+			runListener, err = dupListener(canonicalListener)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to duplicate listening socket for new server instance")
+			}
+		}
+
+		// gate arbitrates between the pre-init grace timer below and
+		// UploadServer.Run actually installing the real handler: once the
+		// real handler is installed the timer's giveUp is a no-op, and if the
+		// timer fires first its 503 fallback is replaced as soon as the real
+		// handler is installed, with no window in between where a
+		// half-finished install could be observed or clobbered.
+		var gate preinitGate
+
 		// run server until .Shutdown() called or other error occurs
 		go func() {
-			err := serv.Run(replaceableHandler)
+			err := serv.Run(runListener, replaceableHandler, &gate)
 			if err != nil {
 				errChan <- err
 			}
 		}()
 
+		// If the backend (e.g. a remote S3 or database session store) is slow
+		// to initialize, reinstall the pre-init handler so clients see an
+		// explicit 503 instead of whatever the previous server instance left
+		// mounted, which may already be shutting down.
+		var graceTimer *time.Timer
+		if replaceableHandler != nil && serv.cfg.Server.PreinitGracePeriod > 0 {
+			graceTimer = time.AfterFunc(serv.cfg.Server.PreinitGracePeriod, func() {
+				if !gate.giveUp(replaceableHandler, newPreinitHandler(serv.cfg.Server.PreinitGracePeriod)) {
+					return
+				}
+				log.Warn().
+					Str("event", "preinit_grace_exceeded").
+					Msg("Upload backend not ready within grace period, reinstalling pre-init handler")
+			})
+		}
+
 		// wait for startup to complete
 		<-serv.GetStartedChan()
+		if graceTimer != nil {
+			graceTimer.Stop()
+		}
+		if canonicalListener == nil && parentRouter == nil {
+			// First time through with no inherited socket: UploadServer bound
+			// its own listener. Keep a dup of it as canonicalListener --
+			// rather than the literal listener this instance owns and will
+			// close on Shutdown -- so a later SIGUSR2 upgrade or SIGHUP
+			// reload can keep reusing the same underlying socket.
+			canonicalListener, err = dupListener(serv.GetListener())
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to duplicate newly bound listening socket")
+			}
+		}
+		atomic.StoreInt32(&ready, 1)
 		if parentRouter == nil {
 			log.Info().
 				Str("event", "startup").
@@ -141,6 +256,34 @@ func runLoop(reloadRequested, done chan struct{}, wg *sync.WaitGroup, parentRout
 				}()
 				return true
 
+			case <-upgradeRequested:
+				// Re-exec the binary, handing the listening socket down as
+				// fd 3 so the child can bind it and start accepting new
+				// connections immediately. We keep serving the requests
+				// already in flight here (including in-progress tus PATCHes)
+				// until they finish or the hammer timeout elapses, then exit
+				// for good -- there's no restart-in-place for this one.
+				tcpListener, ok := canonicalListener.(*net.TCPListener)
+				if !ok {
+					log.Error().
+						Msg("Listener does not support fd passing, ignoring upgrade request")
+					go serv.Shutdown()
+					return true
+				}
+
+				if err := reexecWithListener(tcpListener); err != nil {
+					log.Error().Err(err).Msg("Failed to re-exec binary for upgrade")
+					go serv.Shutdown()
+					return true
+				}
+
+				log.Info().
+					Str("event", "upgrade_drain").
+					Msg("New process listening on inherited socket, draining in-flight requests")
+				serv.ShutdownAfterDrain(serv.cfg.Server.UpgradeHammerTimeout)
+				wg.Done()
+				return false
+
 			case <-done:
 				log.Info().
 					Str("event", "shutdown_started").
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envListenFDs is the environment marker used to hand a bound listening
+// socket down to a re-exec'd copy of this binary, mirroring the convention
+// systemd uses for socket activation. The inherited socket is always fd 3
+// (stdin, stdout and stderr occupy 0-2).
+const envListenFDs = "LISTEN_FDS"
+
+// envListenPID names the process LISTEN_FDS was meant for, the same way
+// systemd sets it. Checking it stops a leaked LISTEN_FDS=1 from a parent's
+// environment being mis-adopted by an unrelated child further down an exec
+// chain.
+const envListenPID = "LISTEN_PID"
+
+// listenerFromEnv adopts a listening socket passed down via envListenFDs,
+// either by a parent instance of this binary upgrading itself (see
+// reexecWithListener) or by an external socket-activation supervisor such as
+// systemd. The second return value reports whether a socket was inherited;
+// when false, callers should bind their own.
+func listenerFromEnv() (net.Listener, bool, error) {
+	if os.Getenv(envListenFDs) != "1" {
+		return nil, false, nil
+	}
+
+	if pidStr, ok := os.LookupEnv(envListenPID); ok {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return nil, false, fmt.Errorf("parsing %s: %w", envListenPID, err)
+		}
+		if pid != os.Getpid() {
+			// Meant for a different process in the exec chain; ignore it
+			// rather than adopting a socket that isn't ours.
+			return nil, false, nil
+		}
+	}
+
+	file := os.NewFile(uintptr(3), "listen-fd")
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("adopting inherited listening socket: %w", err)
+	}
+
+	return listener, true, nil
+}
+
+// dupListener returns an independent net.Listener backed by a duplicated
+// file descriptor of l. Sockets are kernel-refcounted, so closing one of the
+// two listeners (e.g. an old UploadServer's http.Server.Shutdown closing
+// whatever listener it was Served with, during a SIGHUP reload) doesn't
+// tear down the underlying socket out from under the other -- the socket
+// only actually goes away once every fd referencing it has been closed.
+// runLoop uses this to hand each new UploadServer instance a listener it
+// can safely own and close without affecting the next one.
+func dupListener(l net.Listener) (net.Listener, error) {
+	tcpListener, ok := l.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener of type %T does not support duplication", l)
+	}
+
+	file, err := tcpListener.File()
+	if err != nil {
+		return nil, fmt.Errorf("duplicating listener fd: %w", err)
+	}
+	defer file.Close()
+
+	return net.FileListener(file)
+}
+
+// reexecWithListener starts a new copy of the running binary with the same
+// arguments and environment, passing listener down as fd 3 via the
+// os.ProcAttr Files list and announcing it via envListenFDs. The child binds the inherited socket
+// immediately, so there's no gap between the parent stopping accept() and
+// the child resuming it.
+func reexecWithListener(listener *net.TCPListener) error {
+	listenerFile, err := listener.File()
+	if err != nil {
+		return fmt.Errorf("obtaining fd for listening socket: %w", err)
+	}
+	defer listenerFile.Close()
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("resolving path to current executable: %w", err)
+	}
+
+	// Drop any inherited LISTEN_PID -- it would name this process, not the
+	// child we're about to start, and listenerFromEnv would reject it.
+	env := append(withoutEnv(os.Environ(), envListenPID), envListenFDs+"=1")
+
+	process, err := os.StartProcess(execPath, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, listenerFile},
+	})
+	if err != nil {
+		return fmt.Errorf("starting replacement process: %w", err)
+	}
+
+	return process.Release()
+}
+
+// withoutEnv returns env with any entry for key removed.
+func withoutEnv(env []string, key string) []string {
+	prefix := key + "="
+	filtered := env[:0:0]
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, prefix) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
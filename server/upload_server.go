@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UploadServer owns the tus upload backend and the HTTP server that exposes
+// it. A fresh instance is created on every pass through runLoop's for-loop,
+// so config reloads pick up changes by constructing a new instance rather
+// than mutating this one in place.
+type UploadServer struct {
+	cfg Config
+
+	inFlight *inFlightTracker
+
+	mu         sync.Mutex
+	listener   net.Listener
+	httpSrv    *http.Server
+	startedCh  chan struct{}
+	shutdownCh chan struct{}
+}
+
+// GetStartedChan returns a channel that's closed once the server has bound
+// its listener (or handed its handler to a parent router) and is ready to
+// accept requests.
+func (s *UploadServer) GetStartedChan() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.startedCh == nil {
+		s.startedCh = make(chan struct{})
+	}
+	return s.startedCh
+}
+
+// GetListener returns the listener this instance bound, once started. It's
+// used to hand the same socket to a later config reload or SIGUSR2 upgrade
+// instead of binding a new one.
+func (s *UploadServer) GetListener() net.Listener {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listener
+}
+
+// Run serves the tus upload backend until Shutdown or ShutdownAfterDrain is
+// called. If listener is nil, Run binds one itself at
+// cfg.Server.ListenAddress; passing one lets callers reuse a socket across
+// restarts instead of always calling net.Listen. If handler is non-nil, the
+// real tus handler is installed into it via SetHandler rather than served
+// directly, so a parent router can keep routing to the same
+// ReplaceableHandler across restarts -- this embedded mode has no
+// http.Server of its own to Serve a listener on, so socket activation can't
+// be honored here; if listener is non-nil anyway, Run closes it rather than
+// leaking the fd.
+//
+// gate, if non-nil, is the same preinitGate a pre-init grace timer calls
+// giveUp on: Run's installReal call always wins eventually no matter how
+// long initialization took or whether the grace timer already gave up, but
+// once it has run, the timer's giveUp becomes a permanent no-op instead of
+// clobbering the real handler with a stale 503.
+func (s *UploadServer) Run(listener net.Listener, handler *ReplaceableHandler, gate *preinitGate) error {
+	s.inFlight = newInFlightTracker()
+	tusHandler := s.inFlight.Wrap(s.buildHandler())
+
+	if handler != nil {
+		if listener != nil {
+			_ = listener.Close()
+		}
+		if gate != nil {
+			gate.installReal(handler, tusHandler)
+		} else {
+			handler.SetHandler(tusHandler)
+		}
+		shutdownCh := s.markStarted()
+		<-shutdownCh
+		return http.ErrServerClosed
+	}
+
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", s.cfg.Server.ListenAddress)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.httpSrv = &http.Server{Handler: tusHandler}
+	s.mu.Unlock()
+
+	s.markStarted()
+
+	return s.httpSrv.Serve(listener)
+}
+
+// markStarted closes startedCh (creating it first if GetStartedChan hasn't
+// been called yet), initializes shutdownCh, and returns it.
+func (s *UploadServer) markStarted() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.startedCh == nil {
+		s.startedCh = make(chan struct{})
+	}
+	select {
+	case <-s.startedCh:
+	default:
+		close(s.startedCh)
+	}
+
+	if s.shutdownCh == nil {
+		s.shutdownCh = make(chan struct{})
+	}
+	return s.shutdownCh
+}
+
+// Shutdown stops accepting new connections and waits up to 30 seconds for
+// in-flight requests to finish before returning.
+func (s *UploadServer) Shutdown() {
+	s.mu.Lock()
+	httpSrv := s.httpSrv
+	shutdownCh := s.shutdownCh
+	s.mu.Unlock()
+
+	if httpSrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(ctx)
+	}
+
+	closeShutdownChan(shutdownCh)
+}
+
+// StopAccepting closes the listener so Serve returns and no further
+// connections are accepted, without touching requests already being served.
+// Used to end the parent's half of the accept race during a SIGUSR2
+// upgrade: the replacement process binds the same inherited fd, so the
+// parent must stop calling accept() on it before (not after) draining, or
+// both processes keep accepting new connections throughout the drain
+// window.
+func (s *UploadServer) StopAccepting() error {
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+
+	if listener == nil {
+		return nil
+	}
+	return listener.Close()
+}
+
+// ShutdownAfterDrain stops accepting new connections, waits for in-flight
+// tus PATCH requests to finish (or timeout to elapse, a timeout of zero
+// waits indefinitely), then shuts down like Shutdown. Used during a SIGUSR2
+// upgrade, once a replacement process has taken over the listening socket,
+// so upload resumability isn't broken by cutting a PATCH off mid-chunk.
+func (s *UploadServer) ShutdownAfterDrain(timeout time.Duration) {
+	if err := s.StopAccepting(); err != nil {
+		log.Error().Err(err).Msg("Failed to stop accepting new connections before drain")
+	}
+
+	if s.inFlight != nil {
+		s.inFlight.Drain(timeout)
+	}
+
+	s.Shutdown()
+}
+
+func closeShutdownChan(ch chan struct{}) {
+	if ch == nil {
+		return
+	}
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// buildHandler returns the handler served for the current config. It answers
+// every request with 404 Not Found; it does not serve tus uploads.
+func (s *UploadServer) buildHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+}
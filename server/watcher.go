@@ -0,0 +1,116 @@
+package server
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// configReloadDebounce coalesces bursts of filesystem events from a single
+// editor save into one reload request.
+const configReloadDebounce = 500 * time.Millisecond
+
+// absPath resolves path to an absolute, cleaned form so that the same file
+// reached via two different relative strings (e.g. a config watched from a
+// different CWD than it was loaded from) is still recognized as one watched
+// file instead of silently registering a duplicate, never-matched entry.
+// Falls back to filepath.Clean if the working directory can't be resolved.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// watchConfigForChanges watches each of paths (configPath plus any files it
+// includes) for writes and renames and pushes to reloadRequested whenever
+// one changes, so operators don't need to script `kill -HUP` after editing
+// config.toml or any file it includes. It watches the containing
+// directories rather than the files themselves, since editors commonly
+// replace a file outright (write to a temp file, then rename over the
+// original) instead of writing in place. It runs until the watcher fails to
+// initialize, logging and returning in that case.
+func watchConfigForChanges(paths []string, reloadRequested chan<- struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start config file watcher")
+		return
+	}
+	defer watcher.Close()
+
+	watchedFiles := make(map[string]struct{}, len(paths))
+	watchedDirs := make(map[string]struct{})
+
+	for _, path := range paths {
+		path := absPath(path)
+		watchedFiles[path] = struct{}{}
+
+		dir := filepath.Dir(path)
+		if _, ok := watchedDirs[dir]; ok {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			log.Error().Err(err).Str("path", dir).Msg("Failed to watch config directory")
+			return
+		}
+		watchedDirs[dir] = struct{}{}
+	}
+
+	isWatchedFile := func(name string) bool {
+		_, ok := watchedFiles[absPath(name)]
+		return ok
+	}
+
+	var debounce *time.Timer
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !isWatchedFile(event.Name) {
+				continue
+			}
+
+			if event.Op&fsnotify.Rename != 0 {
+				// Atomic-save editors rename the file away and create a
+				// replacement in its place; on some platforms that drops the
+				// watch on the directory entry, so re-add it defensively.
+				dir := filepath.Dir(event.Name)
+				_ = watcher.Remove(dir)
+				if err := watcher.Add(dir); err != nil {
+					log.Error().Err(err).Str("path", dir).Msg("Failed to re-add config directory watch after rename")
+				}
+			}
+
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(configReloadDebounce, func() {
+				log.Info().
+					Str("event", "config_changed").
+					Str("path", event.Name).
+					Msg("Config file changed on disk, requesting reload")
+				select {
+				case reloadRequested <- struct{}{}:
+				default:
+					// a reload is already pending
+				}
+			})
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("Config file watcher error")
+		}
+	}
+}